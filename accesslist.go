@@ -0,0 +1,264 @@
+/*
+Copyright © 2025  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package ratelimit
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+type (
+	// `TRuleAction` identifies what an `AccessList` rule does once a
+	// network prefix matches a client's address.
+	TRuleAction int
+
+	// `TAccessRule` describes the policy bound to a CIDR prefix in an
+	// `AccessList`.
+	//
+	// For `RuleAllow` and `RuleDeny` the `MaxRequests`/`Window` fields
+	// are ignored. For `RuleLimit` they replace the limiter's global
+	// rate limit for clients whose address falls inside `Prefix`.
+	TAccessRule struct {
+		Prefix      netip.Prefix
+		Action      TRuleAction
+		MaxRequests int
+		Window      time.Duration
+
+		limiter *tShardedLimiter // lazily built for `RuleLimit`, unused otherwise
+	}
+
+	// `tTrieNode` is a single node of the binary trie backing
+	// `AccessList`. Every address bit walked selects `children[0]` or
+	// `children[1]`; a non-`nil` `rule` marks a node that terminates a
+	// configured CIDR prefix.
+	tTrieNode struct {
+		children [2]*tTrieNode
+		rule     *TAccessRule
+	}
+
+	// `AccessList` stores CIDR-keyed allow/deny/limit rules in a binary
+	// trie and resolves a client address to its most specific (longest
+	// prefix match) rule. IPv4 addresses are stored in their IPv4-mapped
+	// IPv6 form (`netip.Addr.As16()` already does this), so a single
+	// trie and a single walk cover both address families.
+	//
+	// The zero value is ready to use - `NewAccessList(nil)` is only
+	// needed to pre-populate it with rules up front.
+	AccessList struct {
+		mtx  sync.RWMutex
+		root *tTrieNode
+	}
+)
+
+const (
+	// `RuleAllow` lets matching requests bypass rate limiting entirely.
+	RuleAllow TRuleAction = iota
+
+	// `RuleDeny` rejects matching requests before any counter is touched.
+	RuleDeny
+
+	// `RuleLimit` applies the rule's own `MaxRequests`/`Window` instead
+	// of the limiter's global configuration.
+	RuleLimit
+)
+
+// ---------------------------------------------------------------------------
+// `AccessList` methods:
+
+// `AddRule()` inserts (or replaces) the rule for `aPrefix`.
+//
+// Replacing a `RuleLimit` rule stops the limiter it previously owned,
+// so re-registering a prefix at runtime doesn't leak its cleanup
+// goroutine.
+//
+// Parameters:
+//   - `aPrefix`: The CIDR network the rule applies to.
+//   - `aAction`: Whether matching clients are allowed, denied, or limited.
+//   - `aMaxRequests`: Requests per window, used only when `aAction` is `RuleLimit`.
+//   - `aWindow`: The sliding window duration, used only when `aAction` is `RuleLimit`.
+func (al *AccessList) AddRule(aPrefix netip.Prefix, aAction TRuleAction, aMaxRequests int, aWindow time.Duration) {
+	al.ensureRoot()
+
+	rule := &TAccessRule{
+		Prefix:      aPrefix,
+		Action:      aAction,
+		MaxRequests: aMaxRequests,
+		Window:      aWindow,
+	}
+	if RuleLimit == aAction {
+		rule.limiter = newShardedLimiter(aMaxRequests, aWindow)
+	}
+
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+
+	key, bits := prefixKey(aPrefix)
+	stopRuleLimiter(al.walk(key, bits))
+
+	al.insert(rule)
+} // AddRule()
+
+// `RemoveRule()` removes the rule registered for `aPrefix`, if any,
+// stopping its limiter's cleanup goroutine if it was a `RuleLimit` rule.
+//
+// Parameters:
+//   - `aPrefix`: The CIDR network whose rule should be removed.
+func (al *AccessList) RemoveRule(aPrefix netip.Prefix) {
+	al.ensureRoot()
+
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+
+	node := al.walk(prefixKey(aPrefix))
+	if nil != node {
+		stopRuleLimiter(node)
+		node.rule = nil
+	}
+} // RemoveRule()
+
+// `Lookup()` returns the most specific (longest prefix match) rule
+// covering `aAddr`.
+//
+// Parameters:
+//   - `aAddr`: The client address to resolve a rule for.
+//
+// Returns:
+//   - `*TAccessRule`: The matching rule, or `nil` if none applies.
+//   - `bool`: Whether a rule was found.
+func (al *AccessList) Lookup(aAddr netip.Addr) (*TAccessRule, bool) {
+	al.ensureRoot()
+
+	al.mtx.RLock()
+	defer al.mtx.RUnlock()
+
+	key := aAddr.As16()
+	node, best := al.root, al.root.rule
+
+	for pos := 0; pos < 128; pos++ {
+		child := node.children[bitAt(key, pos)]
+		if nil == child {
+			break
+		}
+		node = child
+		if nil != node.rule {
+			best = node.rule
+		}
+	}
+
+	return best, nil != best
+} // Lookup()
+
+// `ensureRoot()` lazily initializes `al.root`, so an `AccessList` used
+// via its zero value (rather than built through `NewAccessList`) never
+// dereferences a `nil` trie.
+func (al *AccessList) ensureRoot() {
+	al.mtx.RLock()
+	ready := nil != al.root
+	al.mtx.RUnlock()
+	if ready {
+		return
+	}
+
+	al.mtx.Lock()
+	defer al.mtx.Unlock()
+
+	if nil == al.root {
+		al.root = &tTrieNode{}
+	}
+} // ensureRoot()
+
+// `insert()` adds `aRule` to the trie, creating intermediate nodes as
+// needed. The caller must hold `al.mtx`.
+func (al *AccessList) insert(aRule *TAccessRule) {
+	key, bits := prefixKey(aRule.Prefix)
+	node := al.root
+
+	for pos := 0; pos < bits; pos++ {
+		bit := bitAt(key, pos)
+		if nil == node.children[bit] {
+			node.children[bit] = &tTrieNode{}
+		}
+		node = node.children[bit]
+	}
+
+	node.rule = aRule
+} // insert()
+
+// `walk()` returns the trie node that exactly terminates `aPrefix`, or
+// `nil` if no such node exists. The caller must hold `al.mtx`.
+func (al *AccessList) walk(aKey [16]byte, aBits int) *tTrieNode {
+	node := al.root
+
+	for pos := 0; pos < aBits; pos++ {
+		node = node.children[bitAt(aKey, pos)]
+		if nil == node {
+			return nil
+		}
+	}
+
+	return node
+} // walk()
+
+// ---------------------------------------------------------------------------
+// helper functions:
+
+// `stopRuleLimiter()` stops the `RuleLimit` limiter owned by `aNode`'s
+// rule, if any. `aNode` (or its rule) may be `nil`.
+func stopRuleLimiter(aNode *tTrieNode) {
+	if nil == aNode || nil == aNode.rule || nil == aNode.rule.limiter {
+		return
+	}
+
+	aNode.rule.limiter.Stop()
+} // stopRuleLimiter()
+
+// `bitAt()` returns the bit at position `aPos` (0 = most significant)
+// of `aKey`.
+func bitAt(aKey [16]byte, aPos int) int {
+	return int((aKey[aPos/8] >> (7 - uint(aPos%8))) & 1)
+} // bitAt()
+
+// `prefixKey()` returns the 16-byte trie key for `aPrefix` together
+// with the number of significant bits, mapping IPv4 prefixes into the
+// IPv4-mapped IPv6 address space so they share the trie with IPv6
+// prefixes.
+func prefixKey(aPrefix netip.Prefix) ([16]byte, int) {
+	addr := aPrefix.Addr()
+	bits := aPrefix.Bits()
+	if addr.Is4() {
+		bits += 96
+	}
+
+	return addr.As16(), bits
+} // prefixKey()
+
+// ---------------------------------------------------------------------------
+// constructor methods:
+
+// `NewAccessList()` creates an `AccessList` pre-populated with `aRules`.
+//
+// Parameters:
+//   - `aRules`: The initial set of CIDR rules, keyed by their own `Prefix` field.
+//
+// Returns:
+//   - `*AccessList`: The newly created access list.
+func NewAccessList(aRules []TAccessRule) *AccessList {
+	result := &AccessList{
+		root: &tTrieNode{},
+	}
+
+	for _, rule := range aRules {
+		result.AddRule(rule.Prefix, rule.Action, rule.MaxRequests, rule.Window)
+	}
+
+	return result
+} // NewAccessList()
+
+/* _EoF_ */
@@ -0,0 +1,157 @@
+/*
+Copyright © 2025  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package ratelimit
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func Test_AccessList_Lookup(t *testing.T) {
+	al := NewAccessList([]TAccessRule{
+		{Prefix: netip.MustParsePrefix("203.0.113.0/24"), Action: RuleDeny},
+		{Prefix: netip.MustParsePrefix("203.0.113.128/25"), Action: RuleAllow},
+		{Prefix: netip.MustParsePrefix("2001:db8::/32"), Action: RuleDeny},
+		{Prefix: netip.MustParsePrefix("2001:db8:1::/48"), Action: RuleAllow},
+	})
+
+	tests := []struct {
+		name       string
+		addr       string
+		wantFound  bool
+		wantAction TRuleAction
+	}{
+		{name: "IPv4 matches only the broader rule", addr: "203.0.113.1", wantFound: true, wantAction: RuleDeny},
+		{name: "IPv4 matches the more specific rule", addr: "203.0.113.200", wantFound: true, wantAction: RuleAllow},
+		{name: "IPv4 outside any rule", addr: "198.51.100.1", wantFound: false},
+		{name: "IPv6 matches only the broader rule", addr: "2001:db8:2::1", wantFound: true, wantAction: RuleDeny},
+		{name: "IPv6 matches the more specific rule", addr: "2001:db8:1::1", wantFound: true, wantAction: RuleAllow},
+		{name: "IPv6 outside any rule", addr: "2001:db9::1", wantFound: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, found := al.Lookup(netip.MustParseAddr(tt.addr))
+			if found != tt.wantFound {
+				t.Fatalf("Lookup() found = %v, want %v", found, tt.wantFound)
+			}
+			if !found {
+				return
+			}
+			if rule.Action != tt.wantAction {
+				t.Errorf("Lookup() action = %v, want %v", rule.Action, tt.wantAction)
+			}
+		})
+	}
+} // Test_AccessList_Lookup()
+
+func Test_AccessList_RuleLimit_Dispatch(t *testing.T) {
+	al := NewAccessList([]TAccessRule{
+		{Prefix: netip.MustParsePrefix("192.0.2.0/24"), Action: RuleLimit, MaxRequests: 1, Window: time.Minute},
+	})
+
+	addr := netip.MustParseAddr("192.0.2.42")
+	rule, found := al.Lookup(addr)
+	if !found {
+		t.Fatal("expected a RuleLimit rule to be found")
+	}
+	if RuleLimit != rule.Action {
+		t.Fatalf("Action = %v, want RuleLimit", rule.Action)
+	}
+	if nil == rule.limiter {
+		t.Fatal("expected RuleLimit rule to carry a limiter")
+	}
+
+	allowed := 0
+	for i := 0; i < 3; i++ {
+		if rule.limiter.isAllowed(addr.String()) {
+			allowed++
+		}
+	}
+	if 3 <= allowed {
+		t.Errorf("expected the rule's limiter to eventually block, got %d/3 allowed", allowed)
+	}
+} // Test_AccessList_RuleLimit_Dispatch()
+
+func Test_AccessList_AddRule_Replace(t *testing.T) {
+	al := NewAccessList(nil)
+	prefix := netip.MustParsePrefix("198.51.100.0/24")
+
+	al.AddRule(prefix, RuleLimit, 1, time.Minute)
+	first, found := al.Lookup(netip.MustParseAddr("198.51.100.5"))
+	if !found {
+		t.Fatal("expected the first rule to be found")
+	}
+	firstLimiter := first.limiter
+
+	al.AddRule(prefix, RuleDeny, 0, 0)
+	second, found := al.Lookup(netip.MustParseAddr("198.51.100.5"))
+	if !found {
+		t.Fatal("expected the replacement rule to be found")
+	}
+	if RuleDeny != second.Action {
+		t.Errorf("Action = %v, want RuleDeny", second.Action)
+	}
+
+	select {
+	case <-firstLimiter.done:
+		// expected: AddRule() stopped the orphaned limiter
+	default:
+		t.Error("expected the replaced RuleLimit rule's limiter to be stopped")
+	}
+} // Test_AccessList_AddRule_Replace()
+
+func Test_AccessList_ZeroValue(t *testing.T) {
+	var al AccessList
+
+	if _, found := al.Lookup(netip.MustParseAddr("10.0.0.1")); found {
+		t.Error("expected no rule to match an empty zero-value AccessList")
+	}
+
+	al.AddRule(netip.MustParsePrefix("10.0.0.0/8"), RuleDeny, 0, 0)
+	rule, found := al.Lookup(netip.MustParseAddr("10.0.0.1"))
+	if !found {
+		t.Fatal("expected AddRule() to work on a zero-value AccessList")
+	}
+	if RuleDeny != rule.Action {
+		t.Errorf("Action = %v, want RuleDeny", rule.Action)
+	}
+
+	al.RemoveRule(netip.MustParsePrefix("10.0.0.0/8"))
+	if _, found := al.Lookup(netip.MustParseAddr("10.0.0.1")); found {
+		t.Error("expected RemoveRule() to work on a zero-value AccessList")
+	}
+} // Test_AccessList_ZeroValue()
+
+func Test_AccessList_RemoveRule(t *testing.T) {
+	al := NewAccessList(nil)
+	prefix := netip.MustParsePrefix("172.16.0.0/16")
+
+	al.AddRule(prefix, RuleLimit, 1, time.Minute)
+	rule, found := al.Lookup(netip.MustParseAddr("172.16.1.1"))
+	if !found {
+		t.Fatal("expected the rule to be found before removal")
+	}
+	limiter := rule.limiter
+
+	al.RemoveRule(prefix)
+	if _, found := al.Lookup(netip.MustParseAddr("172.16.1.1")); found {
+		t.Error("expected no rule to match after RemoveRule()")
+	}
+
+	select {
+	case <-limiter.done:
+		// expected: RemoveRule() stopped the removed limiter
+	default:
+		t.Error("expected the removed RuleLimit rule's limiter to be stopped")
+	}
+} // Test_AccessList_RemoveRule()
+
+/* _EoF_ */
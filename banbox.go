@@ -0,0 +1,158 @@
+/*
+Copyright © 2025  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package ratelimit
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// `TBanConfig` controls the optional "penalty box" layer: clients
+	// that keep getting blocked by the sliding window are banned
+	// outright for a while, so repeated abuse no longer costs the
+	// sliding-window counter math at all.
+	//
+	// The zero value disables the penalty box (`BanThreshold` of `0`
+	// means no client is ever banned).
+	TBanConfig struct {
+		// `BanThreshold` is the number of blocked requests a client
+		// must accumulate within a single window before it's banned.
+		BanThreshold int
+
+		// `BanDuration` is how long a client is banned for on its
+		// first offense.
+		BanDuration time.Duration
+
+		// `BanEscalationFactor` multiplies `BanDuration` for every
+		// repeat offense (a ban issued again before `BanCooldown` has
+		// passed since the previous one expired).
+		BanEscalationFactor float64
+
+		// `BanDurationCap` limits how long any single ban can last,
+		// regardless of escalation. Zero means uncapped.
+		BanDurationCap time.Duration
+
+		// `BanCooldown` is how long a client must stay clean (no ban
+		// re-triggered) after a ban expires before its escalation
+		// level resets back to the first offense.
+		BanCooldown time.Duration
+	}
+
+	// `tBanRecord` tracks one banned bucket key.
+	tBanRecord struct {
+		expiresAt time.Time
+		strikes   int // number of consecutive escalations applied so far
+	}
+
+	// `tBanBox` is the penalty box: a map of currently/recently banned
+	// bucket keys, guarded by its own lock so checking it never
+	// contends with the sliding-window shard locks.
+	tBanBox struct {
+		mtx  sync.RWMutex
+		bans map[string]*tBanRecord
+	}
+)
+
+// `DefaultBanConfig()` returns a sensible penalty-box configuration:
+// ban for a minute after `20` blocked requests in one window, escalating
+// ×10 per repeat offense up to a one-hour cap, resetting after an hour
+// of clean behaviour.
+func DefaultBanConfig() TBanConfig {
+	return TBanConfig{
+		BanThreshold:        20,
+		BanDuration:         time.Minute,
+		BanEscalationFactor: 10,
+		BanDurationCap:      time.Hour,
+		BanCooldown:         time.Hour,
+	}
+} // DefaultBanConfig()
+
+// ---------------------------------------------------------------------------
+// `tBanBox` methods:
+
+// `remaining()` returns how much longer `aKey`'s current ban lasts, or
+// `0` if it isn't currently banned.
+func (bb *tBanBox) remaining(aKey string) time.Duration {
+	bb.mtx.RLock()
+	defer bb.mtx.RUnlock()
+
+	record, exists := bb.bans[aKey]
+	if !exists {
+		return 0
+	}
+
+	left := time.Until(record.expiresAt)
+	if 0 > left {
+		return 0
+	}
+
+	return left
+} // remaining()
+
+// `ban()` bans `aKey` according to `aConfig`, escalating the duration
+// if it was already serving (or recently finished) a ban within
+// `aConfig.BanCooldown`.
+func (bb *tBanBox) ban(aKey string, aConfig TBanConfig) {
+	bb.mtx.Lock()
+	defer bb.mtx.Unlock()
+
+	now := time.Now().UTC()
+	strikes := 0
+	if prev, exists := bb.bans[aKey]; exists && aConfig.BanCooldown >= now.Sub(prev.expiresAt) {
+		strikes = prev.strikes + 1
+	}
+
+	duration := aConfig.BanDuration
+	for i := 0; i < strikes; i++ {
+		duration = time.Duration(float64(duration) * aConfig.BanEscalationFactor)
+	}
+	if 0 < aConfig.BanDurationCap && aConfig.BanDurationCap < duration {
+		duration = aConfig.BanDurationCap
+	}
+
+	bb.bans[aKey] = &tBanRecord{
+		expiresAt: now.Add(duration),
+		strikes:   strikes,
+	}
+} // ban()
+
+// `unban()` lifts any ban currently held against `aKey`.
+func (bb *tBanBox) unban(aKey string) {
+	bb.mtx.Lock()
+	defer bb.mtx.Unlock()
+
+	delete(bb.bans, aKey)
+} // unban()
+
+// `cleanup()` removes ban records that expired before `aThreshold`,
+// i.e. long enough ago that `BanCooldown` bookkeeping no longer needs
+// them either.
+func (bb *tBanBox) cleanup(aThreshold time.Time) {
+	bb.mtx.Lock()
+	defer bb.mtx.Unlock()
+
+	for key, record := range bb.bans {
+		if record.expiresAt.Before(aThreshold) {
+			delete(bb.bans, key)
+		}
+	}
+} // cleanup()
+
+// ---------------------------------------------------------------------------
+// constructor methods:
+
+// `newBanBox()` creates an empty penalty box.
+func newBanBox() *tBanBox {
+	return &tBanBox{
+		bans: make(map[string]*tBanRecord),
+	}
+} // newBanBox()
+
+/* _EoF_ */
@@ -0,0 +1,111 @@
+/*
+Copyright © 2025  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package ratelimit
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// `TClientKeyFunc` produces the identity a request is rate-limited
+// under. `getClientIP()` (via `ipClientKey()`) is the default when
+// `Wrap()` is given none; callers needing a different notion of
+// "client" - an API key, a session, an authenticated account - supply
+// their own. `TMetrics.ActiveClients` and the shard hash work with any
+// implementation unchanged, since they treat the key as an opaque
+// string.
+type TClientKeyFunc func(aRequest *http.Request) (string, error)
+
+// `ipClientKey()` adapts `getClientIP()` to the `TClientKeyFunc`
+// signature, the way `Wrap()` uses it by default.
+func ipClientKey(aProxyConfig TProxyConfig) TClientKeyFunc {
+	return func(aRequest *http.Request) (string, error) {
+		return getClientIP(aRequest, aProxyConfig)
+	}
+} // ipClientKey()
+
+// `BearerTokenKey()` extracts the client identity from the
+// `Authorization` header, stripping a leading `Bearer ` scheme if
+// present. Useful for rate-limiting authenticated API clients by the
+// token they present rather than by IP.
+func BearerTokenKey(aRequest *http.Request) (string, error) {
+	auth := strings.TrimSpace(aRequest.Header.Get("Authorization"))
+	if "" == auth {
+		return "", fmt.Errorf("missing Authorization header")
+	}
+
+	if rest, found := strings.CutPrefix(auth, "Bearer "); found {
+		auth = strings.TrimSpace(rest)
+	} else if "Bearer" == auth {
+		auth = ""
+	}
+	if "" == auth {
+		return "", fmt.Errorf("empty bearer token")
+	}
+
+	return auth, nil
+} // BearerTokenKey()
+
+// `CookieKey()` returns a `TClientKeyFunc` that uses the value of the
+// named session cookie as the client identity.
+func CookieKey(aCookieName string) TClientKeyFunc {
+	return func(aRequest *http.Request) (string, error) {
+		cookie, err := aRequest.Cookie(aCookieName)
+		if nil != err {
+			return "", fmt.Errorf("missing cookie %q: %w", aCookieName, err)
+		}
+		if "" == cookie.Value {
+			return "", fmt.Errorf("empty cookie %q", aCookieName)
+		}
+
+		return cookie.Value, nil
+	}
+} // CookieKey()
+
+// `HeaderKey()` returns a `TClientKeyFunc` that uses the value of the
+// named header (e.g. `X-Client-ID`) as the client identity.
+func HeaderKey(aHeaderName string) TClientKeyFunc {
+	return func(aRequest *http.Request) (string, error) {
+		value := aRequest.Header.Get(aHeaderName)
+		if "" == value {
+			return "", fmt.Errorf("missing header %q", aHeaderName)
+		}
+
+		return value, nil
+	}
+} // HeaderKey()
+
+// `CompositeKey()` returns a `TClientKeyFunc` that runs `aFuncs` in
+// order and hashes the values of whichever ones succeed into a single
+// identity. Useful when no single source reliably identifies a client
+// on its own (e.g. IP plus a client-ID header behind a shared NAT).
+//
+// It fails only if every one of `aFuncs` fails.
+func CompositeKey(aFuncs ...TClientKeyFunc) TClientKeyFunc {
+	return func(aRequest *http.Request) (string, error) {
+		parts := make([]string, 0, len(aFuncs))
+		for _, keyFunc := range aFuncs {
+			if value, err := keyFunc(aRequest); nil == err {
+				parts = append(parts, value)
+			}
+		}
+		if 0 == len(parts) {
+			return "", fmt.Errorf("composite client key: all sources failed")
+		}
+
+		sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+
+		return hex.EncodeToString(sum[:]), nil
+	}
+} // CompositeKey()
+
+/* _EoF_ */
@@ -0,0 +1,268 @@
+/*
+Copyright © 2025  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package ratelimit
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// `TDuration` is a `time.Duration` that can be decoded from either a
+	// plain number of nanoseconds or a `time.ParseDuration`-style string
+	// (e.g. `"30s"`), so config files can use the human-readable form.
+	TDuration time.Duration
+
+	// `TPolicy` names a rate-limit configuration that can be bound to
+	// one or more routes via `TRouteBinding`.
+	TPolicy struct {
+		Name        string    `json:"name"`
+		MaxRequests int       `json:"max_requests"`
+		Window      TDuration `json:"window"`
+
+		// `CIDRLenIPv4`/`CIDRLenIPv6` override `DefaultCIDRConfig()`
+		// for this policy; zero means "use the default".
+		CIDRLenIPv4 int `json:"cidr_len_v4,omitempty"`
+		CIDRLenIPv6 int `json:"cidr_len_v6,omitempty"`
+
+		// `BanThreshold`/`BanDuration`/`BanEscalationFactor`/
+		// `BanDurationCap`/`BanCooldown` configure this policy's penalty
+		// box (see `TBanConfig`); `BanThreshold` of `0` (the default)
+		// leaves it disabled.
+		BanThreshold        int       `json:"ban_threshold,omitempty"`
+		BanDuration         TDuration `json:"ban_duration,omitempty"`
+		BanEscalationFactor float64   `json:"ban_escalation_factor,omitempty"`
+		BanDurationCap      TDuration `json:"ban_duration_cap,omitempty"`
+		BanCooldown         TDuration `json:"ban_cooldown,omitempty"`
+	}
+
+	// `TRouteBinding` binds a named `TPolicy` to requests matching
+	// `Pattern` (and, optionally, `Method`).
+	//
+	// `Pattern` follows `http.ServeMux` conventions: a pattern ending in
+	// `/` matches the whole subtree, a trailing `/*` is accepted as the
+	// same thing, and anything else must match the path exactly. When
+	// several bindings match a request, the one with the longest
+	// `Pattern` wins - mirroring `http.ServeMux`'s own precedence rule.
+	TRouteBinding struct {
+		Pattern string `json:"pattern"`
+		Method  string `json:"method,omitempty"` // empty matches any method
+		Policy  string `json:"policy"`           // name of the `TPolicy` to apply
+	}
+
+	// `Config` declares a set of named rate-limit policies and the
+	// routes they apply to, for use with `WrapWithConfig()`. It is
+	// decoded from JSON by `LoadConfig()`; there is no YAML support.
+	Config struct {
+		Policies []TPolicy       `json:"policies"`
+		Routes   []TRouteBinding `json:"routes"`
+	}
+
+	// `tRoutedLimiter` pairs a resolved binding with its policy's limiter.
+	tRoutedLimiter struct {
+		binding TRouteBinding
+		limiter *tShardedLimiter
+	}
+)
+
+// ---------------------------------------------------------------------------
+// `TDuration` methods:
+
+// `MarshalJSON()` renders the duration in its human-readable form
+// (e.g. `"1m30s"`).
+func (d TDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+} // MarshalJSON()
+
+// `UnmarshalJSON()` accepts either a JSON number (nanoseconds) or a
+// `time.ParseDuration`-style string.
+func (d *TDuration) UnmarshalJSON(aData []byte) error {
+	var raw any
+	if err := json.Unmarshal(aData, &raw); nil != err {
+		return err
+	}
+
+	switch value := raw.(type) {
+	case float64:
+		*d = TDuration(time.Duration(value))
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if nil != err {
+			return fmt.Errorf("invalid window duration %q: %w", value, err)
+		}
+		*d = TDuration(parsed)
+	default:
+		return fmt.Errorf("invalid window duration: %v", raw)
+	}
+
+	return nil
+} // UnmarshalJSON()
+
+// ---------------------------------------------------------------------------
+// helper functions:
+
+// `routeMatches()` reports whether `aPath` is matched by `aPattern`
+// using `http.ServeMux` subtree conventions.
+func routeMatches(aPattern, aPath string) bool {
+	if strings.HasSuffix(aPattern, "/*") {
+		return strings.HasPrefix(aPath, strings.TrimSuffix(aPattern, "*"))
+	}
+	if strings.HasSuffix(aPattern, "/") {
+		return strings.HasPrefix(aPath, aPattern)
+	}
+
+	return aPattern == aPath
+} // routeMatches()
+
+// `cidrLenOrDefault()` returns `aLen` unless it's zero, in which case
+// `aDefault` is returned.
+func cidrLenOrDefault(aLen, aDefault int) int {
+	if 0 >= aLen {
+		return aDefault
+	}
+
+	return aLen
+} // cidrLenOrDefault()
+
+// ---------------------------------------------------------------------------
+// constructor functions:
+
+// `LoadConfig()` decodes a JSON-encoded `Config` from `aReader`.
+//
+// Parameters:
+//   - `aReader`: The source of the JSON-encoded configuration.
+//
+// Returns:
+//   - `*Config`: The decoded configuration.
+//   - `error`: Any error encountered while decoding.
+func LoadConfig(aReader io.Reader) (*Config, error) {
+	var config Config
+
+	if err := json.NewDecoder(aReader).Decode(&config); nil != err {
+		return nil, fmt.Errorf("decode rate limit config: %w", err)
+	}
+
+	return &config, nil
+} // LoadConfig()
+
+// ---------------------------------------------------------------------------
+// exported functions:
+
+// `WrapWithConfig()` creates a rate limiting middleware handler that
+// dispatches each request to the named policy bound to its route (see
+// `Config.Routes`), instead of applying a single global limit.
+//
+// Requests that match no binding are passed through to `aNext`
+// unthrottled.
+//
+// `aOptions` is optional; only the first value is used, and only its
+// `ProxyConfig`/`ClientKey` are consulted - `AccessList` and `Ban` are
+// configured per policy via `Config` instead. Its `ClientKey`, when
+// set, overrides `ProxyConfig`-based IP detection for every policy,
+// the same way it does in `Wrap()`.
+//
+// Parameters:
+//   - `aNext`: The next handler in the middleware chain.
+//   - `aConfig`: The named policies and their route bindings.
+//   - `aOptions`: Optional trusted-proxy and client-identity settings.
+//
+// Returns:
+//   - `http.Handler`: A new handler that implements per-route rate limiting.
+//   - `func() map[string]TMetrics`: A function returning metrics per policy name.
+//   - `func(string, string) error`: A function that lifts a named policy's penalty-box ban for the given IP (or client key).
+func WrapWithConfig(aNext http.Handler, aConfig *Config, aOptions ...TWrapOptions) (http.Handler, func() map[string]TMetrics, func(string, string) error) {
+	var options TWrapOptions
+	if 0 < len(aOptions) {
+		options = aOptions[0]
+	}
+
+	clientKeyFunc := options.ClientKey
+	if nil == clientKeyFunc {
+		clientKeyFunc = ipClientKey(options.ProxyConfig)
+	}
+
+	limiters := make(map[string]*tShardedLimiter, len(aConfig.Policies))
+	for _, policy := range aConfig.Policies {
+		cidrConfig := DefaultCIDRConfig()
+		cidrConfig.CIDRLenIPv4 = cidrLenOrDefault(policy.CIDRLenIPv4, cidrConfig.CIDRLenIPv4)
+		cidrConfig.CIDRLenIPv6 = cidrLenOrDefault(policy.CIDRLenIPv6, cidrConfig.CIDRLenIPv6)
+
+		banConfig := TBanConfig{
+			BanThreshold:        policy.BanThreshold,
+			BanDuration:         time.Duration(policy.BanDuration),
+			BanEscalationFactor: policy.BanEscalationFactor,
+			BanDurationCap:      time.Duration(policy.BanDurationCap),
+			BanCooldown:         time.Duration(policy.BanCooldown),
+		}
+
+		limiters[policy.Name] = newShardedLimiter(policy.MaxRequests, time.Duration(policy.Window), tLimiterOptions{CIDR: cidrConfig, Ban: banConfig})
+	}
+
+	// Longest pattern wins, mirroring `http.ServeMux` precedence.
+	routes := make([]tRoutedLimiter, 0, len(aConfig.Routes))
+	for _, binding := range aConfig.Routes {
+		if limiter, ok := limiters[binding.Policy]; ok {
+			routes = append(routes, tRoutedLimiter{binding: binding, limiter: limiter})
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].binding.Pattern) > len(routes[j].binding.Pattern)
+	})
+
+	return http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
+			clientIP, err := clientKeyFunc(aRequest)
+			if nil != err {
+				http.Error(aWriter, "Forbidden - Invalid IP", http.StatusForbidden)
+				return
+			}
+
+			for _, route := range routes {
+				if "" != route.binding.Method && !strings.EqualFold(route.binding.Method, aRequest.Method) {
+					continue
+				}
+				if !routeMatches(route.binding.Pattern, aRequest.URL.Path) {
+					continue
+				}
+
+				result := route.limiter.isAllowedInfo(clientIP)
+				setRateLimitHeaders(aWriter, result)
+				if !result.Allowed {
+					http.Error(aWriter, "Rate limit exceeded", http.StatusTooManyRequests)
+					return
+				}
+				aNext.ServeHTTP(aWriter, aRequest)
+				return
+			}
+
+			// No binding matched this request: pass it through.
+			aNext.ServeHTTP(aWriter, aRequest)
+		}),
+		func() map[string]TMetrics {
+			result := make(map[string]TMetrics, len(limiters))
+			for name, limiter := range limiters {
+				result[name] = limiter.GetMetrics()
+			}
+			return result
+		},
+		func(aPolicyName, aIP string) error {
+			limiter, ok := limiters[aPolicyName]
+			if !ok {
+				return fmt.Errorf("unknown policy %q", aPolicyName)
+			}
+			limiter.Unban(aIP)
+			return nil
+		}
+} // WrapWithConfig()
+
+/* _EoF_ */
@@ -0,0 +1,264 @@
+/*
+Copyright © 2025  M.Watermann, 10247 Berlin, Germany
+
+	    All rights reserved
+	EMail : <support@mwat.de>
+*/
+package ratelimit
+
+//lint:file-ignore ST1017 - I prefer Yoda conditions
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_routeMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    bool
+	}{
+		{name: "exact match", pattern: "/api/users", path: "/api/users", want: true},
+		{name: "exact mismatch", pattern: "/api/users", path: "/api/users/1", want: false},
+		{name: "subtree match", pattern: "/api/", path: "/api/users/1", want: true},
+		{name: "subtree root itself", pattern: "/api/", path: "/api/", want: true},
+		{name: "subtree mismatch", pattern: "/api/", path: "/other/", want: false},
+		{name: "trailing wildcard match", pattern: "/api/*", path: "/api/users", want: true},
+		{name: "trailing wildcard mismatch", pattern: "/api/*", path: "/other", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routeMatches(tt.pattern, tt.path); got != tt.want {
+				t.Errorf("routeMatches(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+} // Test_routeMatches()
+
+func Test_TDuration_JSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want time.Duration
+	}{
+		{name: "human-readable string", json: `"30s"`, want: 30 * time.Second},
+		{name: "raw nanoseconds", json: `60000000000`, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d TDuration
+			if err := json.Unmarshal([]byte(tt.json), &d); nil != err {
+				t.Fatalf("UnmarshalJSON(%s) error: %v", tt.json, err)
+			}
+			if time.Duration(d) != tt.want {
+				t.Errorf("UnmarshalJSON(%s) = %v, want %v", tt.json, time.Duration(d), tt.want)
+			}
+		})
+	}
+
+	if _, err := json.Marshal(TDuration(90 * time.Second)); nil != err {
+		t.Fatalf("MarshalJSON() error: %v", err)
+	}
+
+	var bad TDuration
+	if err := json.Unmarshal([]byte(`"not-a-duration"`), &bad); nil == err {
+		t.Error("UnmarshalJSON() expected error for an invalid duration string")
+	}
+	if err := json.Unmarshal([]byte(`true`), &bad); nil == err {
+		t.Error("UnmarshalJSON() expected error for a non-string, non-number value")
+	}
+
+	roundTrip, err := json.Marshal(TDuration(30 * time.Second))
+	if nil != err {
+		t.Fatalf("MarshalJSON() error: %v", err)
+	}
+	var back TDuration
+	if err := json.Unmarshal(roundTrip, &back); nil != err {
+		t.Fatalf("UnmarshalJSON() of own MarshalJSON() output failed: %v", err)
+	}
+	if 30*time.Second != time.Duration(back) {
+		t.Errorf("round trip = %v, want %v", time.Duration(back), 30*time.Second)
+	}
+} // Test_TDuration_JSON()
+
+func Test_LoadConfig(t *testing.T) {
+	const raw = `{
+		"policies": [
+			{"name": "default", "max_requests": 5, "window": "1m"}
+		],
+		"routes": [
+			{"pattern": "/api/", "policy": "default"}
+		]
+	}`
+
+	config, err := LoadConfig(strings.NewReader(raw))
+	if nil != err {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if 1 != len(config.Policies) {
+		t.Fatalf("Policies = %d, want 1", len(config.Policies))
+	}
+	if 5 != config.Policies[0].MaxRequests {
+		t.Errorf("MaxRequests = %d, want 5", config.Policies[0].MaxRequests)
+	}
+	if time.Minute != time.Duration(config.Policies[0].Window) {
+		t.Errorf("Window = %v, want %v", time.Duration(config.Policies[0].Window), time.Minute)
+	}
+
+	if _, err := LoadConfig(strings.NewReader("not json")); nil == err {
+		t.Error("LoadConfig() expected error for malformed input")
+	}
+} // Test_LoadConfig()
+
+func Test_WrapWithConfig_RouteDispatch(t *testing.T) {
+	next := http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
+		aWriter.WriteHeader(http.StatusOK)
+	})
+	config := &Config{
+		Policies: []TPolicy{
+			{Name: "tight", MaxRequests: 1, Window: TDuration(time.Minute)},
+		},
+		Routes: []TRouteBinding{
+			{Pattern: "/limited/", Policy: "tight"},
+		},
+	}
+	handler, metrics, _ := WrapWithConfig(next, config)
+
+	limited, err := http.NewRequest("GET", "http://example.com/limited/x", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	limited.RemoteAddr = "198.51.100.1:12345"
+
+	rec1 := httptest.NewRecorder()
+	handler.ServeHTTP(rec1, limited)
+	if http.StatusOK != rec1.Code {
+		t.Fatalf("first request status = %d, want %d", rec1.Code, http.StatusOK)
+	}
+	if "" == rec1.Header().Get("X-RateLimit-Limit") {
+		t.Error("expected X-RateLimit-Limit header on a routed response")
+	}
+
+	var blocked *httptest.ResponseRecorder
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, limited)
+		if http.StatusTooManyRequests == rec.Code {
+			blocked = rec
+			break
+		}
+	}
+	if nil == blocked {
+		t.Fatal("expected the bound policy to eventually throttle /limited/ requests")
+	}
+	if "" == blocked.Header().Get("Retry-After") {
+		t.Error("expected Retry-After header on a throttled routed response")
+	}
+
+	unbound, err := http.NewRequest("GET", "http://example.com/other", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	unbound.RemoteAddr = "198.51.100.1:12345"
+	recUnbound := httptest.NewRecorder()
+	handler.ServeHTTP(recUnbound, unbound)
+	if http.StatusOK != recUnbound.Code {
+		t.Errorf("unbound route status = %d, want %d", recUnbound.Code, http.StatusOK)
+	}
+
+	if _, ok := metrics()["tight"]; !ok {
+		t.Error("expected metrics for the \"tight\" policy")
+	}
+} // Test_WrapWithConfig_RouteDispatch()
+
+func Test_WrapWithConfig_Unban(t *testing.T) {
+	next := http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
+		aWriter.WriteHeader(http.StatusOK)
+	})
+	config := &Config{
+		Policies: []TPolicy{
+			{
+				Name: "banned", MaxRequests: 1, Window: TDuration(30 * time.Millisecond),
+				BanThreshold: 2, BanDuration: TDuration(time.Hour),
+				BanEscalationFactor: 10, BanDurationCap: TDuration(24 * time.Hour),
+				BanCooldown: TDuration(time.Hour),
+			},
+		},
+		Routes: []TRouteBinding{
+			{Pattern: "/banned/", Policy: "banned"},
+		},
+	}
+	handler, _, unban := WrapWithConfig(next, config)
+
+	req, err := http.NewRequest("GET", "http://example.com/banned/x", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.RemoteAddr = "203.0.113.99:12345"
+
+	var lastCode int
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		lastCode = rec.Code
+	}
+	if http.StatusTooManyRequests != lastCode {
+		t.Fatalf("expected client to be banned, last status was %d", lastCode)
+	}
+
+	if err := unban("no-such-policy", "203.0.113.99"); nil == err {
+		t.Error("unban() expected error for an unknown policy name")
+	}
+	if err := unban("banned", "203.0.113.99"); nil != err {
+		t.Fatalf("unban() error: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond) // let the sliding window itself expire too
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if http.StatusOK != rec.Code {
+		t.Errorf("expected unban() to lift the ban, got status %d", rec.Code)
+	}
+} // Test_WrapWithConfig_Unban()
+
+func Test_WrapWithConfig_ClientKey(t *testing.T) {
+	next := http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
+		aWriter.WriteHeader(http.StatusOK)
+	})
+	config := &Config{
+		Policies: []TPolicy{
+			{Name: "default", MaxRequests: 5, Window: TDuration(time.Minute)},
+		},
+		Routes: []TRouteBinding{
+			{Pattern: "/", Policy: "default"},
+		},
+	}
+	handler, _, _ := WrapWithConfig(next, config, TWrapOptions{ClientKey: HeaderKey("X-Client-ID")})
+
+	req, err := http.NewRequest("GET", "http://example.com/x", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if http.StatusForbidden != rec.Code {
+		t.Errorf("expected a request missing the configured client-key header to be rejected, got %d", rec.Code)
+	}
+
+	req.Header.Set("X-Client-ID", "abc")
+	rec2 := httptest.NewRecorder()
+	handler.ServeHTTP(rec2, req)
+	if http.StatusOK != rec2.Code {
+		t.Errorf("expected a request carrying the configured client-key header to pass, got %d", rec2.Code)
+	}
+} // Test_WrapWithConfig_ClientKey()
+
+/* _EoF_ */
@@ -13,6 +13,8 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -26,18 +28,19 @@ type (
 		sync.Mutex             // protects counter fields
 		prevCount    int       // requests in previous window
 		currentCount int       // requests in current window
+		blockedCount int       // blocked requests seen in the current window
 		windowStart  time.Time // start time of current window
 	}
 
-	// `tClientList` maps IP addresses to their respective request
+	// `tClientList` maps CIDR bucket keys to their respective request
 	// counters.
 	tClientList map[string]*tSlidingWindowCounter
 
 	// `tSlidingWindowShard` represents a single shard of the rate
-	// limiter, managing a subset of client IPs.
+	// limiter, managing a subset of client buckets.
 	tSlidingWindowShard struct {
 		sync.Mutex             // protects clients map
-		clients    tClientList // IP-to-counter map  for this shard
+		clients    tClientList // bucket-key-to-counter map for this shard
 	}
 
 	// `TMetrics` holds rate limiting metrics
@@ -48,6 +51,40 @@ type (
 		CleanupDuration time.Duration // Interval between cleanup runs
 	}
 
+	// `TProxyConfig` controls how `getClientIP()` trusts forwarding
+	// headers. Without it (the zero value), forwarding headers are
+	// never trusted and the direct peer address (`RemoteAddr`) is used
+	// as-is, since a directly connecting client can set any header it
+	// likes.
+	TProxyConfig struct {
+		// `TrustedProxies` lists the networks allowed to supply a
+		// client address via `X-Forwarded-For`/`Forwarded`. An address
+		// is only extracted from those headers once the immediate peer
+		// - and every hop skipped while walking the chain - falls
+		// inside one of these prefixes.
+		TrustedProxies []netip.Prefix
+
+		// `TrustedHeader`, when set, names a single-value header (e.g.
+		// `CF-Connecting-IP` or `True-Client-IP`) that is trusted
+		// unconditionally and takes precedence over
+		// `X-Forwarded-For`/`Forwarded`. Meant for deployments sitting
+		// behind a CDN that sets such a header itself.
+		TrustedHeader string
+	}
+
+	// `TCIDRConfig` controls how client addresses are grouped into rate
+	// limit buckets. Instead of tracking every single address on its
+	// own, addresses are masked down to a network prefix first, so a
+	// whole subnet shares one counter. This mirrors what connection
+	// limiters such as ergo/oragono do to stop a single abusive host
+	// from bypassing per-IP limits by cycling through addresses out of
+	// its own allocation (most notably IPv6, where ISPs commonly hand
+	// out a whole /64 to a single subscriber).
+	TCIDRConfig struct {
+		CIDRLenIPv4 int // prefix length applied to IPv4 addresses (default 32)
+		CIDRLenIPv6 int // prefix length applied to IPv6 addresses (default 64)
+	}
+
 	// `tShardedLimiter` implements a sharded rate limiter that distributes
 	// client IPs across multiple shards to reduce lock contention.
 	tShardedLimiter struct {
@@ -55,10 +92,44 @@ type (
 		maxRequests     int                       // maximum requests per window
 		windowDuration  time.Duration             // duration of the sliding window
 		cleanupInterval time.Duration             // interval between cleanup runs
+		cidrConfig      TCIDRConfig               // network prefix lengths used for bucketing
+		banConfig       TBanConfig                // penalty-box configuration
+		banBox          *tBanBox                  // banned bucket keys, checked before any shard lock
 		metrics         TMetrics                  // metrics for rate limiting
+		done            chan struct{}             // closed by `Stop()` to end the cleanup goroutine
+		stopOnce        sync.Once                 // guards against closing `done` twice
+	}
+
+	// `tLimiterOptions` bundles the optional settings accepted by
+	// `newShardedLimiter()` so the constructor keeps a single,
+	// backward-compatible variadic parameter as the option set grows.
+	tLimiterOptions struct {
+		CIDR TCIDRConfig
+		Ban  TBanConfig
+	}
+
+	// `tRateLimitResult` is the detailed outcome of a rate limit check,
+	// computed from the weighted sliding-window state so callers such as
+	// `Wrap()` can surface `X-RateLimit-*`/`Retry-After` headers without
+	// recomputing the window math themselves.
+	tRateLimitResult struct {
+		Allowed    bool          // whether the request is within the rate limit
+		Remaining  int           // requests still allowed in the current window
+		ResetAfter time.Duration // time until the current window's weight has fully decayed
+		Limit      int           // the window's configured maximum requests
 	}
 )
 
+// `DefaultCIDRConfig()` returns the default CIDR grouping configuration:
+// a full `/32` for IPv4 (i.e. one bucket per host) and a `/64` for IPv6
+// (i.e. one bucket per subscriber allocation).
+func DefaultCIDRConfig() TCIDRConfig {
+	return TCIDRConfig{
+		CIDRLenIPv4: 32,
+		CIDRLenIPv6: 64,
+	}
+} // DefaultCIDRConfig()
+
 // ---------------------------------------------------------------------------
 // `tSlidingWindowShard` methods:
 
@@ -97,45 +168,96 @@ func (sws *tSlidingWindowShard) cleanShard(aThreshold time.Time) {
 // ---------------------------------------------------------------------------
 // `tShardedLimiter` methods:
 
-// `cleanup()` performs maintenance on all shards by removing inactive clients.
+// `cleanup()` performs maintenance on all shards by removing inactive
+// clients, and purges expired entries from the penalty box.
 func (sl *tShardedLimiter) cleanup() {
 	threshold := time.Now().UTC().Add(-sl.windowDuration * 2)
 
 	for _, sws := range sl.shards {
 		sws.cleanShard(threshold)
 	}
+
+	sl.banBox.cleanup(threshold.Add(-sl.banConfig.BanCooldown))
 } // cleanup()
 
 // `cleanupStart()` initiates a background goroutine that periodically
-// cleans up inactive clients from all shards.
+// cleans up inactive clients from all shards, until `Stop()` is called.
 func (sl *tShardedLimiter) cleanupStart() {
 	ticker := time.NewTicker(sl.cleanupInterval)
 
 	go func() {
-		for range ticker.C {
-			sl.cleanup()
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sl.cleanup()
+			case <-sl.done:
+				return
+			}
 		}
 	}()
 } // cleanupStart()
 
-// `getShard()` returns the appropriate shard for a given IP address
+// `Stop()` ends the background cleanup goroutine started by
+// `cleanupStart()`. Callers that discard a `*tShardedLimiter` - e.g.
+// `AccessList.AddRule()`/`RemoveRule()` replacing a `RuleLimit` rule's
+// limiter - must call this first, or the goroutine leaks forever.
+//
+// It's safe to call more than once.
+func (sl *tShardedLimiter) Stop() {
+	sl.stopOnce.Do(func() {
+		close(sl.done)
+	})
+} // Stop()
+
+// `getShard()` returns the appropriate shard for a given bucket key
 // using a hash-based distribution.
 //
 // Parameters:
-//   - `aIP`: The IP address of the client making the request.
+//   - `aKey`: The CIDR bucket key (see `cidrKey()`) of the client making the request.
 //
 // Returns:
-//   - `*tSlidingWindowShard`: The shard holding the given IP address.
-func (sl *tShardedLimiter) getShard(aIP string) *tSlidingWindowShard {
-	// Simple hash function for IP-based sharding
+//   - `*tSlidingWindowShard`: The shard holding the given bucket key.
+func (sl *tShardedLimiter) getShard(aKey string) *tSlidingWindowShard {
+	// Simple hash function for key-based sharding
 	sum := 0
-	for i := 0; i < len(aIP); i++ {
-		sum += int(aIP[i])
+	for i := 0; i < len(aKey); i++ {
+		sum += int(aKey[i])
 	}
 
 	return sl.shards[sum%256]
 } // getShard()
 
+// `cidrKey()` derives the rate-limit bucket key for an address by
+// masking it down to the configured CIDR prefix length, so every host
+// inside the same network shares one counter.
+//
+// Parameters:
+//   - `aAddr`: The client address to derive the bucket key for.
+//
+// Returns:
+//   - `string`: The canonical `netip.Prefix` string used as the bucket key.
+func (sl *tShardedLimiter) cidrKey(aAddr netip.Addr) string {
+	addr := aAddr
+	bits := sl.cidrConfig.CIDRLenIPv4
+	if addr.Is4In6() {
+		addr = addr.Unmap()
+	}
+	if addr.Is6() {
+		bits = sl.cidrConfig.CIDRLenIPv6
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if nil != err {
+		// Invalid prefix length (shouldn't happen with sane config):
+		// fall back to the plain address so we still get a valid key.
+		return addr.String()
+	}
+
+	return prefix.String()
+} // cidrKey()
+
 func (sl *tShardedLimiter) GetMetrics() TMetrics {
 	var total uint64
 	for _, shard := range sl.shards {
@@ -155,28 +277,109 @@ func (sl *tShardedLimiter) GetMetrics() TMetrics {
 // `isAllowed()` checks if a request from the given IP address is
 // allowed based on the rate limiting rules.
 //
+// The address is parsed and masked down to its configured CIDR bucket
+// (see `cidrKey()`) before the rate limit is checked, so all hosts
+// inside the same network share one counter. Addresses that can't be
+// parsed are used verbatim as their own bucket key.
+//
+// It's a thin wrapper around `isAllowedInfo()` for callers that only
+// care about the yes/no answer.
+//
 // Parameters:
 //   - `aIP`: The IP address of the client making the request.
 //
 // Returns:
 //   - `bool`: Whether the request is within the rate limits.
 func (sl *tShardedLimiter) isAllowed(aIP string) bool {
+	return sl.isAllowedInfo(aIP).Allowed
+} // isAllowed()
+
+// `isAllowedInfo()` is the `tRateLimitResult` counterpart of
+// `isAllowed()`, giving callers such as `Wrap()` the window accounting
+// behind the yes/no answer so they can surface `X-RateLimit-*` headers.
+//
+// Parameters:
+//   - `aIP`: The IP address of the client making the request.
+//
+// Returns:
+//   - `tRateLimitResult`: The detailed rate limit outcome.
+func (sl *tShardedLimiter) isAllowedInfo(aIP string) tRateLimitResult {
+	if addr, err := netip.ParseAddr(aIP); nil == err {
+		return sl.isAllowedAddrInfo(addr)
+	}
+
+	return sl.isAllowedKeyInfo(aIP)
+} // isAllowedInfo()
+
+// `isAllowedAddr()` is the `netip.Addr` counterpart of `isAllowed()`,
+// avoiding a string round-trip when the caller already has a parsed
+// address (e.g. from `getClientIP()`).
+//
+// Parameters:
+//   - `aAddr`: The parsed address of the client making the request.
+//
+// Returns:
+//   - `bool`: Whether the request is within the rate limits.
+func (sl *tShardedLimiter) isAllowedAddr(aAddr netip.Addr) bool {
+	return sl.isAllowedAddrInfo(aAddr).Allowed
+} // isAllowedAddr()
+
+// `isAllowedAddrInfo()` is the `tRateLimitResult` counterpart of
+// `isAllowedAddr()`.
+func (sl *tShardedLimiter) isAllowedAddrInfo(aAddr netip.Addr) tRateLimitResult {
+	return sl.isAllowedKeyInfo(sl.cidrKey(aAddr))
+} // isAllowedAddrInfo()
+
+// `isAllowedKey()` checks if a request for the given bucket key is
+// allowed based on the rate limiting rules.
+//
+// Parameters:
+//   - `aKey`: The CIDR bucket key identifying the client's network.
+//
+// Returns:
+//   - `bool`: Whether the request is within the rate limits.
+func (sl *tShardedLimiter) isAllowedKey(aKey string) bool {
+	return sl.isAllowedKeyInfo(aKey).Allowed
+} // isAllowedKey()
+
+// `isAllowedKeyInfo()` is the `tRateLimitResult` counterpart of
+// `isAllowedKey()`, and does the actual rate-limiting work; every other
+// `isAllowed*` variant funnels into this one.
+//
+// Parameters:
+//   - `aKey`: The CIDR bucket key identifying the client's network.
+//
+// Returns:
+//   - `tRateLimitResult`: The detailed rate limit outcome.
+func (sl *tShardedLimiter) isAllowedKeyInfo(aKey string) tRateLimitResult {
 	atomic.AddUint64(&sl.metrics.TotalRequests, 1)
 
-	shard := sl.getShard(aIP)
+	if banLeft := sl.banBox.remaining(aKey); 0 < banLeft {
+		// Banned clients are rejected without ever touching a shard
+		// lock or the sliding-window counter math.
+		atomic.AddUint64(&sl.metrics.BlockedRequests, 1)
+		return tRateLimitResult{Limit: sl.maxRequests, ResetAfter: banLeft}
+	}
+
+	shard := sl.getShard(aKey)
 	shard.Lock()
 	defer shard.Unlock()
 
 	now := time.Now().UTC() // Use UTC to avoid DST issues
-	counter, exists := shard.clients[aIP]
+	counter, exists := shard.clients[aKey]
 	if !exists {
 		counter = &tSlidingWindowCounter{
 			currentCount: 1,
 			windowStart:  now,
 		}
-		shard.clients[aIP] = counter
+		shard.clients[aKey] = counter
 		// First request is always allowed
-		return true
+		return tRateLimitResult{
+			Allowed:    true,
+			Remaining:  sl.maxRequests - 1,
+			ResetAfter: sl.windowDuration,
+			Limit:      sl.maxRequests,
+		}
 	}
 
 	counter.Lock()
@@ -187,8 +390,14 @@ func (sl *tShardedLimiter) isAllowed(aIP string) bool {
 		// Window has expired, shift window
 		counter.prevCount = counter.currentCount
 		counter.currentCount = 1
+		counter.blockedCount = 0
 		counter.windowStart = now
-		return true
+		return tRateLimitResult{
+			Allowed:    true,
+			Remaining:  sl.maxRequests - 1,
+			ResetAfter: sl.windowDuration,
+			Limit:      sl.maxRequests,
+		}
 	}
 
 	// Calculate the weight of the previous window
@@ -197,15 +406,61 @@ func (sl *tShardedLimiter) isAllowed(aIP string) bool {
 	// Calculate total requests using weighted sliding window
 	weightedCount := int(float64(counter.prevCount)*weightPrev) + counter.currentCount
 
-	allowed := weightedCount <= sl.maxRequests
-	if allowed {
+	result := tRateLimitResult{
+		Remaining:  sl.maxRequests - weightedCount,
+		ResetAfter: sl.windowDuration - elapsed,
+		Limit:      sl.maxRequests,
+	}
+	if 0 > result.Remaining {
+		result.Remaining = 0
+	}
+
+	result.Allowed = weightedCount <= sl.maxRequests
+	if result.Allowed {
 		counter.currentCount++
 	} else {
 		atomic.AddUint64(&sl.metrics.BlockedRequests, 1)
+
+		counter.blockedCount++
+		if 0 < sl.banConfig.BanThreshold && counter.blockedCount >= sl.banConfig.BanThreshold {
+			sl.banBox.ban(aKey, sl.banConfig)
+			counter.blockedCount = 0
+		}
 	}
 
-	return allowed
-} // isAllowed()
+	return result
+} // isAllowedKeyInfo()
+
+// `setRateLimitHeaders()` sets the `X-RateLimit-*` headers describing
+// `aResult`, plus `Retry-After` when the request was blocked, so that
+// well-behaved clients and CDNs sitting in front of the handler can
+// back off correctly.
+func setRateLimitHeaders(aWriter http.ResponseWriter, aResult tRateLimitResult) {
+	header := aWriter.Header()
+	resetSeconds := strconv.Itoa(int(aResult.ResetAfter.Seconds()))
+
+	header.Set("X-RateLimit-Limit", strconv.Itoa(aResult.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(aResult.Remaining))
+	header.Set("X-RateLimit-Reset", resetSeconds)
+
+	if !aResult.Allowed {
+		header.Set("Retry-After", resetSeconds)
+	}
+} // setRateLimitHeaders()
+
+// `Unban()` lifts any penalty-box ban currently held against `aIP`,
+// regardless of how it was grouped into a bucket key.
+//
+// Parameters:
+//   - `aIP`: The IP address (or CIDR bucket key) to unban.
+func (sl *tShardedLimiter) Unban(aIP string) {
+	if addr, err := netip.ParseAddr(aIP); nil == err {
+		sl.banBox.unban(sl.cidrKey(addr))
+		return
+	}
+
+	sl.banBox.unban(aIP)
+} // Unban()
 
 // ---------------------------------------------------------------------------
 // helper functions:
@@ -241,51 +496,149 @@ func cleanIP(aIP string) string {
 // `getClientIP()` extracts and validates the client's IP address from
 // an HTTP request.
 //
-// The function handles both IPv4 and IPv6 addresses and properly processes
-// `X-Forwarded-For` headers in proxy chains. It follows these steps to
-// determine the client IP:
-// 1. Check `X-Forwarded-For` header
-// 2. Extract the leftmost valid IP (original client)
-// 3. Fall back to `RemoteAddr` if no valid IP is found
-// 4. Clean and validate the IP address
+// The function handles both IPv4 and IPv6 addresses. Forwarding headers
+// (`X-Forwarded-For`, `Forwarded`, or a configurable single-value header
+// such as `CF-Connecting-IP`) are only honoured once the immediate peer
+// is a trusted proxy, since a directly connecting client can set any of
+// these headers itself. It follows these steps to determine the client IP:
+//  1. If `aConfig.TrustedHeader` is set and present, use its value.
+//  2. Determine the immediate peer from `RemoteAddr`.
+//  3. If the peer isn't listed in `aConfig.TrustedProxies`, use the peer
+//     address as-is.
+//  4. Otherwise walk `Forwarded`/`X-Forwarded-For` from right to left,
+//     skipping entries that are themselves trusted proxies, and return
+//     the first untrusted (i.e. client) address found.
+//
+// `aConfig` is optional; when omitted forwarding headers are never
+// trusted. Only the first value is used.
 //
 // Parameters:
 //   - `aRequest`: The incoming HTTP request containing client information.
+//   - `aConfig`: Optional trusted-proxy configuration.
 //
 // Returns:
 //   - `string`: A validated client IP address
 //   - `error`: Error if no valid IP address could be determined
-func getClientIP(aRequest *http.Request) (string, error) {
-	// First try `X-Forwarded-For` header
-	if xff := aRequest.Header.Get("X-Forwarded-For"); "" != xff {
-		// Split IPs and get the original client IP (leftmost)
-		ips := strings.Split(xff, ",")
-		for _, ip := range ips {
-			// Clean the IP string
-			ip = strings.TrimSpace(ip)
-			if validIP := cleanIP(ip); "" != validIP {
+func getClientIP(aRequest *http.Request, aConfig ...TProxyConfig) (string, error) {
+	var config TProxyConfig
+	if 0 < len(aConfig) {
+		config = aConfig[0]
+	}
+
+	if "" != config.TrustedHeader {
+		if hv := aRequest.Header.Get(config.TrustedHeader); "" != hv {
+			if validIP := cleanIP(strings.TrimSpace(hv)); "" != validIP {
 				return validIP, nil
 			}
 		}
 	}
 
-	// Fall back to `RemoteAddr`
-	host, _, err := net.SplitHostPort(aRequest.RemoteAddr)
+	peerHost, _, err := net.SplitHostPort(aRequest.RemoteAddr)
 	if err != nil {
 		// Try `RemoteAddr` directly in case it's just an IP
-		if validIP := cleanIP(aRequest.RemoteAddr); "" != validIP {
-			return validIP, nil
-		}
+		peerHost = aRequest.RemoteAddr
+	}
+	peerIP := cleanIP(peerHost)
+	if "" == peerIP {
+		return "", fmt.Errorf("invalid RemoteAddr: %s", aRequest.RemoteAddr)
+	}
+
+	peerAddr, err := netip.ParseAddr(peerIP)
+	if nil != err {
 		return "", fmt.Errorf("invalid RemoteAddr: %v", err)
 	}
 
-	if validIP := cleanIP(host); "" != validIP {
-		return validIP, nil
+	if !isTrustedProxy(peerAddr, config.TrustedProxies) {
+		// The peer itself isn't a trusted proxy, so any forwarding
+		// header it sent could be forged: use its address as-is.
+		return peerIP, nil
+	}
+
+	chain := forwardedChain(aRequest)
+	for i := len(chain) - 1; 0 <= i; i-- {
+		candidate := cleanIP(chain[i])
+		if "" == candidate {
+			continue
+		}
+		addr, addrErr := netip.ParseAddr(candidate)
+		if nil != addrErr {
+			continue
+		}
+		if !isTrustedProxy(addr, config.TrustedProxies) {
+			return candidate, nil
+		}
+	}
+
+	// The whole chain consists of trusted proxies: fall back to the
+	// original (leftmost) entry as a best effort.
+	for _, entry := range chain {
+		if validIP := cleanIP(entry); "" != validIP {
+			return validIP, nil
+		}
 	}
 
-	return "", fmt.Errorf("no valid IP address found")
+	return peerIP, nil
 } // getClientIP()
 
+// `isTrustedProxy()` reports whether `aAddr` falls inside any of
+// `aTrusted`.
+func isTrustedProxy(aAddr netip.Addr, aTrusted []netip.Prefix) bool {
+	for _, prefix := range aTrusted {
+		if prefix.Contains(aAddr) {
+			return true
+		}
+	}
+
+	return false
+} // isTrustedProxy()
+
+// `forwardedChain()` returns the proxy chain advertised by a request,
+// preferring the standardised `Forwarded` header (RFC 7239) over the
+// de-facto `X-Forwarded-For`, in left-to-right (original-client-first)
+// order.
+func forwardedChain(aRequest *http.Request) []string {
+	if fwd := aRequest.Header.Get("Forwarded"); "" != fwd {
+		return parseForwardedHeader(fwd)
+	}
+
+	if xff := aRequest.Header.Get("X-Forwarded-For"); "" != xff {
+		parts := strings.Split(xff, ",")
+		for i, part := range parts {
+			parts[i] = strings.TrimSpace(part)
+		}
+		return parts
+	}
+
+	return nil
+} // forwardedChain()
+
+// `parseForwardedHeader()` extracts the `for=` tokens from an RFC 7239
+// `Forwarded` header value, stripping quotes, brackets, and ports.
+func parseForwardedHeader(aHeader string) []string {
+	var result []string
+
+	for _, element := range strings.Split(aHeader, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			pair = strings.TrimSpace(pair)
+			if !strings.HasPrefix(strings.ToLower(pair), "for=") {
+				continue
+			}
+
+			value := strings.Trim(strings.TrimSpace(pair[len("for="):]), `"`)
+			value = strings.TrimPrefix(value, "[")
+			if idx := strings.Index(value, "]"); 0 <= idx {
+				value = value[:idx]
+			} else if idx := strings.LastIndex(value, ":"); 0 <= idx && 1 == strings.Count(value, ":") {
+				value = value[:idx]
+			}
+			result = append(result, value)
+			break
+		}
+	}
+
+	return result
+} // parseForwardedHeader()
+
 // ---------------------------------------------------------------------------
 // constructor methods:
 
@@ -297,12 +650,28 @@ func newShard() *tSlidingWindowShard {
 } // newShard()
 
 // `newShardedLimiter()` creates a new sharded rate limiter.
-func newShardedLimiter(aMaxReq int, aDuration time.Duration) *tShardedLimiter {
+//
+// `aOptions` is optional; when omitted, CIDR bucketing defaults to
+// `DefaultCIDRConfig()` and the penalty box is disabled. Only the
+// first value is used.
+func newShardedLimiter(aMaxReq int, aDuration time.Duration, aOptions ...tLimiterOptions) *tShardedLimiter {
+	var options tLimiterOptions
+	if 0 < len(aOptions) {
+		options = aOptions[0]
+	}
+	defaultCIDR := DefaultCIDRConfig()
+	options.CIDR.CIDRLenIPv4 = cidrLenOrDefault(options.CIDR.CIDRLenIPv4, defaultCIDR.CIDRLenIPv4)
+	options.CIDR.CIDRLenIPv6 = cidrLenOrDefault(options.CIDR.CIDRLenIPv6, defaultCIDR.CIDRLenIPv6)
+
 	result := &tShardedLimiter{
 		maxRequests:     aMaxReq,
 		windowDuration:  aDuration,
 		cleanupInterval: aDuration * 2,
+		cidrConfig:      options.CIDR,
+		banConfig:       options.Ban,
+		banBox:          newBanBox(),
 		metrics:         TMetrics{},
+		done:            make(chan struct{}),
 	}
 
 	for i := range result.shards {
@@ -318,30 +687,117 @@ func newShardedLimiter(aMaxReq int, aDuration time.Duration) *tShardedLimiter {
 // ---------------------------------------------------------------------------
 // exported functions:
 
+type (
+	// `TWrapOptions` bundles the optional, less frequently used settings
+	// for `Wrap()` so the function doesn't accumulate one variadic
+	// parameter per feature.
+	TWrapOptions struct {
+		// `AccessList` holds CIDR-based allow/deny/limit rules,
+		// consulted after the client IP has been determined.
+		AccessList *AccessList
+
+		// `ProxyConfig` controls whether/how forwarding headers are
+		// trusted when determining the client IP; see `getClientIP()`.
+		// Ignored when `ClientKey` is set.
+		ProxyConfig TProxyConfig
+
+		// `ClientKey` overrides how the rate-limit identity is derived
+		// from a request. Defaults to the client IP (via
+		// `getClientIP()`/`ProxyConfig`) when left `nil`.
+		ClientKey TClientKeyFunc
+
+		// `Ban` configures the penalty box (see `TBanConfig`) for the
+		// limiter created by `Wrap()`. The zero value leaves the penalty
+		// box disabled.
+		Ban TBanConfig
+
+		// `CIDR` overrides `DefaultCIDRConfig()` for grouping client
+		// addresses into rate-limit buckets; each field left at `0`
+		// falls back to the default independently.
+		CIDR TCIDRConfig
+	}
+)
+
 // `Wrap()` creates a new rate limiting middleware handler.
 // It uses a sliding window algorithm to limit requests per client IP.
 //
+// `aOptions` is optional; only the first value is used. When its
+// `AccessList` is set, it is consulted after the client IP has been
+// determined: `RuleAllow` bypasses rate limiting entirely, `RuleDeny`
+// rejects the request without touching any counter, and `RuleLimit`
+// applies the matching rule's own `MaxRequests`/`Window` instead of
+// `aMaxReq`/`aDuration`. Its `ProxyConfig` is passed to `getClientIP()`
+// to control whether forwarding headers are trusted, and its `CIDR`
+// controls how client addresses are grouped into rate-limit buckets.
+//
+// Every response carries `X-RateLimit-Limit`, `X-RateLimit-Remaining`,
+// and `X-RateLimit-Reset` headers describing the rate limit state, and
+// a throttled (429) response additionally carries `Retry-After`, both
+// in seconds, so well-behaved clients and CDNs can back off correctly.
+//
+// When its `Ban` is set, clients that keep getting blocked are banned
+// outright for a while (see `TBanConfig`); the returned unban function
+// lifts such a ban administratively.
+//
 // Parameters:
 //   - `aNext`: The next handler in the middleware chain.
 //   - `aMaxReq`: Maximum number of requests allowed per window.
 //   - `aDuration`: The time window duration.
+//   - `aOptions`: Optional access-list, trusted-proxy, CIDR, and penalty-box settings.
 //
 // Returns:
 //   - `http.Handler`: A new handler that implements rate limiting
 //   - `func() TMetrics`: A function that returns usage metrics.
-func Wrap(aNext http.Handler, aMaxReq int, aDuration time.Duration) (http.Handler, func() TMetrics) {
-	limiter := newShardedLimiter(aMaxReq, aDuration)
+//   - `func(string)`: A function that lifts a penalty-box ban for the given IP (or client key).
+func Wrap(aNext http.Handler, aMaxReq int, aDuration time.Duration, aOptions ...TWrapOptions) (http.Handler, func() TMetrics, func(string)) {
+	var options TWrapOptions
+	if 0 < len(aOptions) {
+		options = aOptions[0]
+	}
+
+	limiter := newShardedLimiter(aMaxReq, aDuration, tLimiterOptions{CIDR: options.CIDR, Ban: options.Ban})
+
+	clientKeyFunc := options.ClientKey
+	if nil == clientKeyFunc {
+		clientKeyFunc = ipClientKey(options.ProxyConfig)
+	}
 
 	// Return both the handler and a function that returns metrics
 	return http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
-			// Get and validate client IP
-			clientIP, err := getClientIP(aRequest)
+			// Get and validate the client's rate-limit identity
+			clientKey, err := clientKeyFunc(aRequest)
 			if nil != err {
-				http.Error(aWriter, "Forbidden - Invalid IP", http.StatusForbidden)
+				http.Error(aWriter, "Forbidden - Unable to identify client", http.StatusForbidden)
 				return
 			}
 
-			if !limiter.isAllowed(clientIP) {
+			if nil != options.AccessList {
+				if addr, addrErr := netip.ParseAddr(clientKey); nil == addrErr {
+					if rule, found := options.AccessList.Lookup(addr); found {
+						switch rule.Action {
+						case RuleAllow:
+							aNext.ServeHTTP(aWriter, aRequest)
+							return
+						case RuleDeny:
+							http.Error(aWriter, "Forbidden - Access Denied", http.StatusForbidden)
+							return
+						case RuleLimit:
+							ruleResult := rule.limiter.isAllowedInfo(clientKey)
+							setRateLimitHeaders(aWriter, ruleResult)
+							if !ruleResult.Allowed {
+								http.Error(aWriter, "Rate limit exceeded", http.StatusTooManyRequests)
+								return
+							}
+							aNext.ServeHTTP(aWriter, aRequest)
+							return
+						}
+					}
+				}
+			}
+
+			result := limiter.isAllowedInfo(clientKey)
+			setRateLimitHeaders(aWriter, result)
+			if !result.Allowed {
 				http.Error(aWriter, "Rate limit exceeded", http.StatusTooManyRequests)
 				return
 			}
@@ -350,6 +806,9 @@ func Wrap(aNext http.Handler, aMaxReq int, aDuration time.Duration) (http.Handle
 		}),
 		func() TMetrics {
 			return limiter.GetMetrics()
+		},
+		func(aIP string) {
+			limiter.Unban(aIP)
 		}
 } // Wrap()
 
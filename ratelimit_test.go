@@ -11,6 +11,9 @@ package ratelimit
 import (
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -18,11 +21,13 @@ import (
 
 func Test_getClientIP(t *testing.T) {
 	tests := []struct {
-		name       string
-		remoteAddr string
-		headers    map[string]string
-		wantIP     string
-		wantErr    bool
+		name           string
+		remoteAddr     string
+		headers        map[string]string
+		trustedProxies []string
+		trustedHeader  string
+		wantIP         string
+		wantErr        bool
 	}{
 		{
 			name:       "Valid IPv4",
@@ -39,22 +44,64 @@ func Test_getClientIP(t *testing.T) {
 			wantErr:    false,
 		},
 		{
-			name:       "Valid X-Forwarded-For single IP",
+			name:       "X-Forwarded-For from untrusted peer is ignored",
 			remoteAddr: "10.0.0.1:8080",
 			headers: map[string]string{
 				"X-Forwarded-For": "203.0.113.195",
 			},
-			wantIP:  "203.0.113.195",
+			wantIP:  "10.0.0.1",
 			wantErr: false,
 		},
 		{
-			name:       "Valid X-Forwarded-For multiple IPs",
+			name:       "X-Forwarded-For single IP via trusted proxy",
+			remoteAddr: "10.0.0.1:8080",
+			headers: map[string]string{
+				"X-Forwarded-For": "203.0.113.195",
+			},
+			trustedProxies: []string{"10.0.0.1/32"},
+			wantIP:         "203.0.113.195",
+			wantErr:        false,
+		},
+		{
+			name:       "X-Forwarded-For chain via trusted proxies",
 			remoteAddr: "10.0.0.1:8080",
 			headers: map[string]string{
 				"X-Forwarded-For": "203.0.113.195, 70.41.3.18, 150.172.238.178",
 			},
-			wantIP:  "203.0.113.195",
-			wantErr: false,
+			trustedProxies: []string{"10.0.0.1/32", "70.41.3.18/32", "150.172.238.178/32"},
+			wantIP:         "203.0.113.195",
+			wantErr:        false,
+		},
+		{
+			name:       "X-Forwarded-For chain stops at first untrusted hop",
+			remoteAddr: "10.0.0.1:8080",
+			headers: map[string]string{
+				"X-Forwarded-For": "203.0.113.195, 70.41.3.18, 150.172.238.178",
+			},
+			trustedProxies: []string{"10.0.0.1/32", "150.172.238.178/32"},
+			wantIP:         "70.41.3.18",
+			wantErr:        false,
+		},
+		{
+			name:       "Forwarded header via trusted proxy",
+			remoteAddr: "10.0.0.1:8080",
+			headers: map[string]string{
+				"Forwarded": `for=203.0.113.195, for="[2001:db8::cafe]:443"`,
+			},
+			trustedProxies: []string{"10.0.0.1/32", "2001:db8::cafe/128"},
+			wantIP:         "203.0.113.195",
+			wantErr:        false,
+		},
+		{
+			name:       "Configurable trusted header takes precedence",
+			remoteAddr: "10.0.0.1:8080",
+			headers: map[string]string{
+				"X-Forwarded-For":  "198.51.100.1",
+				"CF-Connecting-IP": "203.0.113.9",
+			},
+			trustedHeader: "CF-Connecting-IP",
+			wantIP:        "203.0.113.9",
+			wantErr:       false,
 		},
 		{
 			name:       "Invalid RemoteAddr",
@@ -64,22 +111,24 @@ func Test_getClientIP(t *testing.T) {
 			wantErr:    true,
 		},
 		{
-			name:       "Invalid X-Forwarded-For",
+			name:       "Invalid X-Forwarded-For via trusted proxy",
 			remoteAddr: "10.0.0.1:8080",
 			headers: map[string]string{
 				"X-Forwarded-For": "invalid-ip",
 			},
-			wantIP:  "10.0.0.1",
-			wantErr: false,
+			trustedProxies: []string{"10.0.0.1/32"},
+			wantIP:         "10.0.0.1",
+			wantErr:        false,
 		},
 		{
-			name:       "Empty X-Forwarded-For",
+			name:       "Empty X-Forwarded-For via trusted proxy",
 			remoteAddr: "10.0.0.1:8080",
 			headers: map[string]string{
 				"X-Forwarded-For": "",
 			},
-			wantIP:  "10.0.0.1",
-			wantErr: false,
+			trustedProxies: []string{"10.0.0.1/32"},
+			wantIP:         "10.0.0.1",
+			wantErr:        false,
 		},
 	}
 
@@ -95,7 +144,12 @@ func Test_getClientIP(t *testing.T) {
 				req.Header.Set(key, value)
 			}
 
-			gotIP, err := getClientIP(req)
+			config := TProxyConfig{TrustedHeader: tt.trustedHeader}
+			for _, p := range tt.trustedProxies {
+				config.TrustedProxies = append(config.TrustedProxies, netip.MustParsePrefix(p))
+			}
+
+			gotIP, err := getClientIP(req, config)
 			if (nil != err) != tt.wantErr {
 				t.Errorf("getClientIP() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -110,7 +164,7 @@ func Test_getClientIP(t *testing.T) {
 func Test_isAllowed(t *testing.T) {
 	tests := []struct {
 		name           string
-		maxRequests    uint
+		maxRequests    int
 		windowDuration time.Duration
 		scenario       func(*tShardedLimiter) bool
 	}{
@@ -136,7 +190,7 @@ func Test_isAllowed(t *testing.T) {
 			maxRequests:    1,
 			windowDuration: time.Second * 30,
 			scenario: func(sl *tShardedLimiter) bool {
-				sl.isAllowed("192.168.1.3") // First request
+				sl.isAllowed("192.168.1.3")        // First request
 				return sl.isAllowed("192.168.1.3") // Second request should be blocked
 			},
 		},
@@ -250,4 +304,299 @@ func Test_isAllowed_Concurrent(t *testing.T) {
 	t.Logf("Concurrent test completed in %v", duration)
 } // Test_isAllowed_Concurrent()
 
+func Test_isAllowed_PenaltyBox(t *testing.T) {
+	limiter := newShardedLimiter(1, 30*time.Millisecond, tLimiterOptions{
+		Ban: TBanConfig{
+			BanThreshold:        2,
+			BanDuration:         time.Hour,
+			BanEscalationFactor: 10,
+			BanDurationCap:      24 * time.Hour,
+			BanCooldown:         time.Hour,
+		},
+	})
+
+	ip := "203.0.113.7"
+	for i := 0; i < 4; i++ {
+		// Two of these exceed the window's single-request limit,
+		// reaching the ban threshold.
+		limiter.isAllowed(ip)
+	}
+
+	if limiter.isAllowed(ip) {
+		t.Error("Expected client to be banned after reaching the threshold")
+	}
+
+	limiter.Unban(ip)
+	if 0 < limiter.banBox.remaining(limiter.cidrKey(mustParseAddr(ip))) {
+		t.Error("Expected Unban() to lift the ban")
+	}
+} // Test_isAllowed_PenaltyBox()
+
+func Test_newShardedLimiter_PartialCIDRDefaulting(t *testing.T) {
+	limiter := newShardedLimiter(1, time.Second, tLimiterOptions{
+		CIDR: TCIDRConfig{CIDRLenIPv4: 24},
+	})
+
+	if 24 != limiter.cidrConfig.CIDRLenIPv4 {
+		t.Errorf("CIDRLenIPv4 = %d, want 24", limiter.cidrConfig.CIDRLenIPv4)
+	}
+	if DefaultCIDRConfig().CIDRLenIPv6 != limiter.cidrConfig.CIDRLenIPv6 {
+		t.Errorf("CIDRLenIPv6 = %d, want the default %d", limiter.cidrConfig.CIDRLenIPv6, DefaultCIDRConfig().CIDRLenIPv6)
+	}
+
+	key := limiter.cidrKey(mustParseAddr("2001:db8::1"))
+	if "::/0" == key {
+		t.Fatalf("cidrKey() = %q: unset CIDRLenIPv6 collapsed all IPv6 clients into one bucket", key)
+	}
+} // Test_newShardedLimiter_PartialCIDRDefaulting()
+
+func mustParseAddr(aIP string) netip.Addr {
+	addr, err := netip.ParseAddr(aIP)
+	if nil != err {
+		panic(err)
+	}
+
+	return addr
+} // mustParseAddr()
+
+func Test_BearerTokenKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{name: "Bearer token", header: "Bearer abc123", want: "abc123"},
+		{name: "Raw token without scheme", header: "abc123", want: "abc123"},
+		{name: "Missing header", header: "", wantErr: true},
+		{name: "Bearer with empty token", header: "Bearer ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "http://example.com", nil)
+			if nil != err {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			if "" != tt.header {
+				req.Header.Set("Authorization", tt.header)
+			}
+
+			got, err := BearerTokenKey(req)
+			if (nil != err) != tt.wantErr {
+				t.Errorf("BearerTokenKey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("BearerTokenKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+} // Test_BearerTokenKey()
+
+func Test_CookieKey(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.AddCookie(&http.Cookie{Name: "session", Value: "sess123"})
+
+	keyFunc := CookieKey("session")
+	got, err := keyFunc(req)
+	if nil != err {
+		t.Fatalf("CookieKey() unexpected error: %v", err)
+	}
+	if "sess123" != got {
+		t.Errorf("CookieKey() = %v, want %v", got, "sess123")
+	}
+
+	if _, err := CookieKey("missing")(req); nil == err {
+		t.Error("CookieKey() expected error for missing cookie")
+	}
+} // Test_CookieKey()
+
+func Test_HeaderKey(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("X-Client-ID", "client42")
+
+	keyFunc := HeaderKey("X-Client-ID")
+	got, err := keyFunc(req)
+	if nil != err {
+		t.Fatalf("HeaderKey() unexpected error: %v", err)
+	}
+	if "client42" != got {
+		t.Errorf("HeaderKey() = %v, want %v", got, "client42")
+	}
+
+	if _, err := HeaderKey("X-Missing")(req); nil == err {
+		t.Error("HeaderKey() expected error for missing header")
+	}
+} // Test_HeaderKey()
+
+func Test_CompositeKey(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("X-Client-ID", "client42")
+
+	keyFunc := CompositeKey(HeaderKey("X-Client-ID"), HeaderKey("X-Missing"))
+	got1, err := keyFunc(req)
+	if nil != err {
+		t.Fatalf("CompositeKey() unexpected error: %v", err)
+	}
+
+	got2, err := keyFunc(req)
+	if nil != err {
+		t.Fatalf("CompositeKey() unexpected error: %v", err)
+	}
+	if got1 != got2 {
+		t.Errorf("CompositeKey() not deterministic: %v != %v", got1, got2)
+	}
+
+	if _, err := CompositeKey(HeaderKey("X-Missing"))(req); nil == err {
+		t.Error("CompositeKey() expected error when all sources fail")
+	}
+} // Test_CompositeKey()
+
+func Test_Wrap_CIDR(t *testing.T) {
+	next := http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
+		aWriter.WriteHeader(http.StatusOK)
+	})
+	handler, _, _ := Wrap(next, 1, time.Minute, TWrapOptions{
+		CIDR: TCIDRConfig{CIDRLenIPv4: 24},
+	})
+
+	// Two different IPv4 hosts in the same /24 share a bucket, so the
+	// second one should be throttled too.
+	first, err := http.NewRequest("GET", "http://example.com", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	first.RemoteAddr = "198.51.100.1:12345"
+	rec1 := httptest.NewRecorder()
+	handler.ServeHTTP(rec1, first)
+	if http.StatusOK != rec1.Code {
+		t.Fatalf("first request status = %d, want %d", rec1.Code, http.StatusOK)
+	}
+
+	second, err := http.NewRequest("GET", "http://example.com", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	second.RemoteAddr = "198.51.100.2:12345"
+
+	var blocked bool
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, second)
+		if http.StatusTooManyRequests == rec.Code {
+			blocked = true
+			break
+		}
+	}
+	if !blocked {
+		t.Error("expected a different host in the same /24 to eventually share the bucket's limit")
+	}
+} // Test_Wrap_CIDR()
+
+func Test_Wrap_RateLimitHeaders(t *testing.T) {
+	next := http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
+		aWriter.WriteHeader(http.StatusOK)
+	})
+	handler, _, _ := Wrap(next, 1, time.Minute)
+
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.RemoteAddr = "198.51.100.1:12345"
+
+	rec1 := httptest.NewRecorder()
+	handler.ServeHTTP(rec1, req)
+	if got := rec1.Header().Get("X-RateLimit-Limit"); "1" != got {
+		t.Errorf("X-RateLimit-Limit = %v, want %v", got, "1")
+	}
+	if "" == rec1.Header().Get("X-RateLimit-Remaining") {
+		t.Error("X-RateLimit-Remaining header missing")
+	}
+	if "" == rec1.Header().Get("X-RateLimit-Reset") {
+		t.Error("X-RateLimit-Reset header missing")
+	}
+	if "" != rec1.Header().Get("Retry-After") {
+		t.Error("Retry-After should not be set on an allowed request")
+	}
+
+	var blocked *httptest.ResponseRecorder
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if http.StatusTooManyRequests == rec.Code {
+			blocked = rec
+			break
+		}
+	}
+	if nil == blocked {
+		t.Fatal("expected request to eventually be throttled")
+	}
+	if got := blocked.Header().Get("X-RateLimit-Remaining"); "0" != got {
+		t.Errorf("X-RateLimit-Remaining = %v, want %v", got, "0")
+	}
+	if "" == blocked.Header().Get("Retry-After") {
+		t.Error("Retry-After header missing on throttled response")
+	}
+} // Test_Wrap_RateLimitHeaders()
+
+func Test_Wrap_BanAndUnban(t *testing.T) {
+	next := http.HandlerFunc(func(aWriter http.ResponseWriter, aRequest *http.Request) {
+		aWriter.WriteHeader(http.StatusOK)
+	})
+	handler, _, unban := Wrap(next, 1, 30*time.Millisecond, TWrapOptions{
+		Ban: TBanConfig{
+			BanThreshold:        2,
+			BanDuration:         time.Hour,
+			BanEscalationFactor: 10,
+			BanDurationCap:      24 * time.Hour,
+			BanCooldown:         time.Hour,
+		},
+	})
+
+	req, err := http.NewRequest("GET", "http://example.com", nil)
+	if nil != err {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.RemoteAddr = "203.0.113.77:12345"
+
+	var lastCode int
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		lastCode = rec.Code
+	}
+	if http.StatusTooManyRequests != lastCode {
+		t.Fatalf("expected client to be banned, last status was %d", lastCode)
+	}
+
+	// By now the client is serving its ban; the next response's
+	// Retry-After should reflect the ~1-hour ban, not the zero value a
+	// banned-but-uninitialised result would carry.
+	banned := httptest.NewRecorder()
+	handler.ServeHTTP(banned, req)
+	if retrySeconds, err := strconv.Atoi(banned.Header().Get("Retry-After")); nil != err || 3000 > retrySeconds {
+		t.Errorf("Retry-After on a banned response = %q, want a value close to 3600 seconds", banned.Header().Get("Retry-After"))
+	}
+
+	unban("203.0.113.77")
+	time.Sleep(40 * time.Millisecond) // let the sliding window itself expire too
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if http.StatusOK != rec.Code {
+		t.Errorf("expected unban() to lift the ban, got status %d", rec.Code)
+	}
+} // Test_Wrap_BanAndUnban()
+
 /* _EoF_ */